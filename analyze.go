@@ -0,0 +1,379 @@
+package isuexporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"strconv"
+	"text/tabwriter"
+	"time"
+)
+
+// AnalyzeOptions は Analyze の集計対象を絞り込む条件を保持する
+type AnalyzeOptions struct {
+	since             time.Time
+	until             time.Time
+	serviceName       string
+	attributeMatchers map[string]string
+}
+
+// AnalyzeOption は Analyze に渡す関数オプション
+type AnalyzeOption func(*AnalyzeOptions)
+
+// WithTimeWindow は開始時刻が [since, until] の範囲に入るスパンだけを集計対象にする。
+// ゼロ値を渡すとその側の境界は無視される。
+func WithTimeWindow(since, until time.Time) AnalyzeOption {
+	return func(o *AnalyzeOptions) {
+		o.since = since
+		o.until = until
+	}
+}
+
+// WithServiceNameFilter は指定した service.name を持つスパンだけを集計対象にする
+func WithServiceNameFilter(name string) AnalyzeOption {
+	return func(o *AnalyzeOptions) {
+		o.serviceName = name
+	}
+}
+
+// WithAttributeMatcher は key属性の値が value と完全一致するスパンだけを集計対象にする。
+// 複数回指定するとAND条件になる。
+func WithAttributeMatcher(key, value string) AnalyzeOption {
+	return func(o *AnalyzeOptions) {
+		if o.attributeMatchers == nil {
+			o.attributeMatchers = map[string]string{}
+		}
+		o.attributeMatchers[key] = value
+	}
+}
+
+// StatGroup は件数と継続時間の分布(合計/平均/p50/p90/p95/p99)、エラー率を保持する
+type StatGroup struct {
+	Count      int           `json:"count"`
+	ErrorCount int           `json:"errorCount"`
+	Sum        time.Duration `json:"sum"`
+	Avg        time.Duration `json:"avg"`
+	P50        time.Duration `json:"p50"`
+	P90        time.Duration `json:"p90"`
+	P95        time.Duration `json:"p95"`
+	P99        time.Duration `json:"p99"`
+
+	durations []time.Duration
+}
+
+func (g *StatGroup) add(d time.Duration, isErr bool) {
+	g.Count++
+	g.Sum += d
+	g.durations = append(g.durations, d)
+	if isErr {
+		g.ErrorCount++
+	}
+}
+
+func (g *StatGroup) finalize() {
+	if g.Count == 0 {
+		return
+	}
+	g.Avg = g.Sum / time.Duration(g.Count)
+	sort.Slice(g.durations, func(i, j int) bool { return g.durations[i] < g.durations[j] })
+	g.P50 = percentile(g.durations, 0.50)
+	g.P90 = percentile(g.durations, 0.90)
+	g.P95 = percentile(g.durations, 0.95)
+	g.P99 = percentile(g.durations, 0.99)
+}
+
+// ErrorRate はこのグループ内でエラーステータスだったスパンの割合を返す
+func (g *StatGroup) ErrorRate() float64 {
+	if g.Count == 0 {
+		return 0
+	}
+	return float64(g.ErrorCount) / float64(g.Count)
+}
+
+func percentile(sorted []time.Duration, p float64) time.Duration {
+	if len(sorted) == 0 {
+		return 0
+	}
+	idx := int(math.Ceil(p*float64(len(sorted)))) - 1
+	if idx < 0 {
+		idx = 0
+	}
+	if idx >= len(sorted) {
+		idx = len(sorted) - 1
+	}
+	return sorted[idx]
+}
+
+// Report は Analyze の集計結果。スパン名ごと、HTTPルートごと、SQL文ごとの
+// 内訳を含む alp/pt-query-digest 風のレポート。
+type Report struct {
+	TotalSpans int                   `json:"totalSpans"`
+	Overall    *StatGroup            `json:"overall"`
+	ByName     map[string]*StatGroup `json:"byName"`
+	ByRoute    map[string]*StatGroup `json:"byRoute,omitempty"`
+	BySQL      map[string]*StatGroup `json:"bySQL,omitempty"`
+}
+
+// Analyze は FileSpanExporter が書き出した NDJSON を読み取り、スパン名・
+// HTTPルート(http.route属性)・SQL文(db.statement属性)ごとの件数・継続時間分布・
+// エラー率を集計する。WithOTLPJSONFormat で書かれた OTLP/JSON 形式と、デフォルトの
+// spanToMap 形式の両方を1行ずつ自動判別して読む。spanToMap 形式にはリソース
+// (service.name)が含まれないため、WithServiceNameFilter 指定時はその形式の行を
+// 読み飛ばす。
+func Analyze(r io.Reader, opts ...AnalyzeOption) (*Report, error) {
+	options := &AnalyzeOptions{}
+	for _, opt := range opts {
+		opt(options)
+	}
+
+	report := &Report{
+		Overall: &StatGroup{},
+		ByName:  map[string]*StatGroup{},
+		ByRoute: map[string]*StatGroup{},
+		BySQL:   map[string]*StatGroup{},
+	}
+
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 0, 64*1024), 10*1024*1024)
+	for scanner.Scan() {
+		line := bytes.TrimSpace(scanner.Bytes())
+		if len(line) == 0 {
+			continue
+		}
+
+		// OTLP/JSON のResourceSpansにしかない scopeSpans の有無でフォーマットを判別する
+		var probe struct {
+			ScopeSpans json.RawMessage `json:"scopeSpans"`
+		}
+		if err := json.Unmarshal(line, &probe); err != nil {
+			return nil, fmt.Errorf("failed to parse span line: %w", err)
+		}
+
+		if probe.ScopeSpans != nil {
+			var rs otlpResourceSpans
+			if err := json.Unmarshal(line, &rs); err != nil {
+				return nil, fmt.Errorf("failed to parse span line: %w", err)
+			}
+			if options.serviceName != "" && otlpAttributeString(rs.Resource.Attributes, "service.name") != options.serviceName {
+				continue
+			}
+			for _, scopeSpans := range rs.ScopeSpans {
+				for _, span := range scopeSpans.Spans {
+					report.addOTLPSpan(span, options)
+				}
+			}
+			continue
+		}
+
+		if options.serviceName != "" {
+			// spanToMap形式にはservice.nameが含まれないため、絞り込み指定時は対象外にする
+			continue
+		}
+		var span legacySpan
+		if err := json.Unmarshal(line, &span); err != nil {
+			return nil, fmt.Errorf("failed to parse span line: %w", err)
+		}
+		report.addLegacySpan(span, options)
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, err
+	}
+
+	report.Overall.finalize()
+	for _, g := range report.ByName {
+		g.finalize()
+	}
+	for _, g := range report.ByRoute {
+		g.finalize()
+	}
+	for _, g := range report.BySQL {
+		g.finalize()
+	}
+	if len(report.ByRoute) == 0 {
+		report.ByRoute = nil
+	}
+	if len(report.BySQL) == 0 {
+		report.BySQL = nil
+	}
+
+	return report, nil
+}
+
+// legacyAttribute は spanToMap が出力する attribute.KeyValue のJSON表現
+// ({"Key":"...","Value":{"Type":"...","Value":...}}) に対応する
+type legacyAttribute struct {
+	Key   string `json:"Key"`
+	Value struct {
+		Type  string          `json:"Type"`
+		Value json.RawMessage `json:"Value"`
+	} `json:"Value"`
+}
+
+// legacySpan は spanToMap (FileSpanExporter のデフォルト出力形式)1行分の構造
+type legacySpan struct {
+	Name       string            `json:"name"`
+	StartTime  time.Time         `json:"startTime"`
+	EndTime    time.Time         `json:"endTime"`
+	Attributes []legacyAttribute `json:"attributes"`
+	Status     struct {
+		Code string `json:"code"`
+	} `json:"status"`
+}
+
+func (report *Report) addOTLPSpan(span otlpSpan, options *AnalyzeOptions) {
+	startNano, err := strconv.ParseInt(span.StartTimeUnixNano, 10, 64)
+	if err != nil {
+		return
+	}
+	endNano, err := strconv.ParseInt(span.EndTimeUnixNano, 10, 64)
+	if err != nil {
+		return
+	}
+	isErr := span.Status.Code == 2 // statusCodeToOTLPのSTATUS_CODE_ERROR
+	report.record(span.Name, time.Unix(0, startNano), time.Unix(0, endNano), isErr, otlpAttrsToMap(span.Attributes), options)
+}
+
+func (report *Report) addLegacySpan(span legacySpan, options *AnalyzeOptions) {
+	isErr := span.Status.Code == "Error" // codes.Code.String()の表記に合わせる
+	report.record(span.Name, span.StartTime, span.EndTime, isErr, legacyAttrsToMap(span.Attributes), options)
+}
+
+// record はフォーマットに依存しない集計処理。時間範囲と属性マッチャーで絞り込んだ上で
+// 全体・スパン名別・ルート別・SQL文別の StatGroup に反映する。
+func (report *Report) record(name string, start, end time.Time, isErr bool, attrs map[string]string, options *AnalyzeOptions) {
+	if !options.since.IsZero() && start.Before(options.since) {
+		return
+	}
+	if !options.until.IsZero() && start.After(options.until) {
+		return
+	}
+	if !matchesAttributes(attrs, options.attributeMatchers) {
+		return
+	}
+
+	duration := end.Sub(start)
+
+	report.TotalSpans++
+	report.Overall.add(duration, isErr)
+
+	nameGroup := report.ByName[name]
+	if nameGroup == nil {
+		nameGroup = &StatGroup{}
+		report.ByName[name] = nameGroup
+	}
+	nameGroup.add(duration, isErr)
+
+	if route := attrs["http.route"]; route != "" {
+		g := report.ByRoute[route]
+		if g == nil {
+			g = &StatGroup{}
+			report.ByRoute[route] = g
+		}
+		g.add(duration, isErr)
+	}
+
+	if stmt := attrs["db.statement"]; stmt != "" {
+		g := report.BySQL[stmt]
+		if g == nil {
+			g = &StatGroup{}
+			report.BySQL[stmt] = g
+		}
+		g.add(duration, isErr)
+	}
+}
+
+func otlpValueString(v otlpAnyValue) string {
+	switch {
+	case v.StringValue != nil:
+		return *v.StringValue
+	case v.IntValue != nil:
+		return *v.IntValue
+	case v.BoolValue != nil:
+		return strconv.FormatBool(*v.BoolValue)
+	case v.DoubleValue != nil:
+		return strconv.FormatFloat(*v.DoubleValue, 'f', -1, 64)
+	}
+	return ""
+}
+
+func otlpAttributeString(attrs []otlpKeyValue, key string) string {
+	for _, kv := range attrs {
+		if kv.Key == key {
+			return otlpValueString(kv.Value)
+		}
+	}
+	return ""
+}
+
+func otlpAttrsToMap(attrs []otlpKeyValue) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, kv := range attrs {
+		m[kv.Key] = otlpValueString(kv.Value)
+	}
+	return m
+}
+
+func legacyAttrString(raw json.RawMessage) string {
+	var s string
+	if err := json.Unmarshal(raw, &s); err == nil {
+		return s
+	}
+	return string(raw)
+}
+
+func legacyAttrsToMap(attrs []legacyAttribute) map[string]string {
+	m := make(map[string]string, len(attrs))
+	for _, a := range attrs {
+		m[a.Key] = legacyAttrString(a.Value.Value)
+	}
+	return m
+}
+
+func matchesAttributes(attrs map[string]string, matchers map[string]string) bool {
+	for key, want := range matchers {
+		if attrs[key] != want {
+			return false
+		}
+	}
+	return true
+}
+
+// WriteTable はalp/pt-query-digest風の人間向けテーブルとしてレポートを書き出す
+func WriteTable(w io.Writer, report *Report) error {
+	tw := tabwriter.NewWriter(w, 0, 4, 2, ' ', 0)
+
+	fmt.Fprintf(tw, "total spans: %d\n\n", report.TotalSpans)
+
+	fmt.Fprintln(tw, "NAME\tCOUNT\tERR%\tSUM\tAVG\tP50\tP90\tP95\tP99")
+	writeStatRows(tw, report.ByName)
+
+	if len(report.ByRoute) > 0 {
+		fmt.Fprintln(tw, "\nROUTE\tCOUNT\tERR%\tSUM\tAVG\tP50\tP90\tP95\tP99")
+		writeStatRows(tw, report.ByRoute)
+	}
+
+	if len(report.BySQL) > 0 {
+		fmt.Fprintln(tw, "\nSQL\tCOUNT\tERR%\tSUM\tAVG\tP50\tP90\tP95\tP99")
+		writeStatRows(tw, report.BySQL)
+	}
+
+	return tw.Flush()
+}
+
+func writeStatRows(tw *tabwriter.Writer, groups map[string]*StatGroup) {
+	names := make([]string, 0, len(groups))
+	for name := range groups {
+		names = append(names, name)
+	}
+	sort.Slice(names, func(i, j int) bool { return groups[names[i]].Sum > groups[names[j]].Sum })
+
+	for _, name := range names {
+		g := groups[name]
+		fmt.Fprintf(tw, "%s\t%d\t%.1f%%\t%s\t%s\t%s\t%s\t%s\t%s\n",
+			name, g.Count, g.ErrorRate()*100, g.Sum, g.Avg, g.P50, g.P90, g.P95, g.P99)
+	}
+}
@@ -0,0 +1,91 @@
+package isuexporter_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	isuexporter "github.com/mikanbox/isuexporter"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// recordSampleSpan は1本のHTTPハンドラ風スパン(http.route/db.statement属性付き)を
+// 作り、exporterを同期Exportさせてからファイルを閉じる
+func recordSampleSpan(t *testing.T, path string, opts ...isuexporter.FileExporterOption) {
+	t.Helper()
+
+	exporter, err := isuexporter.NewFileSpanExporter(path, opts...)
+	if err != nil {
+		t.Fatalf("NewFileSpanExporter: %v", err)
+	}
+
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+
+	_, span := tp.Tracer("test").Start(context.Background(), "GET /items",
+		oteltrace.WithAttributes(
+			attribute.String("http.route", "/items"),
+			attribute.String("db.statement", "SELECT * FROM items"),
+		),
+	)
+	span.End()
+
+	if err := tp.Shutdown(context.Background()); err != nil {
+		t.Fatalf("Shutdown: %v", err)
+	}
+}
+
+func TestAnalyze_LegacySpanToMapFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	recordSampleSpan(t, path)
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	report, err := isuexporter.Analyze(f)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if report.TotalSpans != 1 {
+		t.Fatalf("TotalSpans = %d, want 1", report.TotalSpans)
+	}
+	if g := report.ByRoute["/items"]; g == nil || g.Count != 1 {
+		t.Errorf("ByRoute[/items] = %+v", g)
+	}
+	if g := report.BySQL["SELECT * FROM items"]; g == nil || g.Count != 1 {
+		t.Errorf("BySQL[...] = %+v", g)
+	}
+}
+
+func TestAnalyze_OTLPJSONFormat(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "trace.jsonl")
+	recordSampleSpan(t, path, isuexporter.WithOTLPJSONFormat())
+
+	f, err := os.Open(path)
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	defer f.Close()
+
+	report, err := isuexporter.Analyze(f)
+	if err != nil {
+		t.Fatalf("Analyze: %v", err)
+	}
+	if report.TotalSpans != 1 {
+		t.Fatalf("TotalSpans = %d, want 1", report.TotalSpans)
+	}
+	if g := report.ByRoute["/items"]; g == nil || g.Count != 1 {
+		t.Errorf("ByRoute[/items] = %+v", g)
+	}
+	if g := report.BySQL["SELECT * FROM items"]; g == nil || g.Count != 1 {
+		t.Errorf("BySQL[...] = %+v", g)
+	}
+}
@@ -0,0 +1,101 @@
+// Command isuexporter-analyze reads the NDJSON span file produced by
+// isuexporter.FileSpanExporter (either the default format or
+// WithOTLPJSONFormat; -service only matches OTLP/JSON lines) and prints an
+// alp/pt-query-digest-style report of per-span-name, per-route, and
+// per-SQL-statement latency and error rate.
+package main
+
+import (
+	"encoding/json"
+	"flag"
+	"fmt"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/mikanbox/isuexporter"
+)
+
+// attrFlag は -attr key=value を複数回指定できるようにするための flag.Value 実装
+type attrFlag map[string]string
+
+func (a attrFlag) String() string {
+	pairs := make([]string, 0, len(a))
+	for k, v := range a {
+		pairs = append(pairs, k+"="+v)
+	}
+	return strings.Join(pairs, ",")
+}
+
+func (a attrFlag) Set(raw string) error {
+	key, value, ok := strings.Cut(raw, "=")
+	if !ok {
+		return fmt.Errorf("expected key=value, got %q", raw)
+	}
+	a[key] = value
+	return nil
+}
+
+func main() {
+	if err := run(); err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(1)
+	}
+}
+
+func run() error {
+	filePath := flag.String("file", "trace.jsonl", "NDJSON span file written by isuexporter's FileSpanExporter")
+	format := flag.String("format", "table", "output format: table or json")
+	serviceName := flag.String("service", "", "only aggregate spans with this service.name")
+	since := flag.String("since", "", "only aggregate spans starting at or after this RFC3339 time")
+	until := flag.String("until", "", "only aggregate spans starting at or before this RFC3339 time")
+	attrs := make(attrFlag)
+	flag.Var(attrs, "attr", "only aggregate spans matching key=value attribute (repeatable)")
+	flag.Parse()
+
+	opts := []isuexporter.AnalyzeOption{}
+	if *serviceName != "" {
+		opts = append(opts, isuexporter.WithServiceNameFilter(*serviceName))
+	}
+
+	var sinceTime, untilTime time.Time
+	var err error
+	if *since != "" {
+		if sinceTime, err = time.Parse(time.RFC3339, *since); err != nil {
+			return fmt.Errorf("invalid -since: %w", err)
+		}
+	}
+	if *until != "" {
+		if untilTime, err = time.Parse(time.RFC3339, *until); err != nil {
+			return fmt.Errorf("invalid -until: %w", err)
+		}
+	}
+	if !sinceTime.IsZero() || !untilTime.IsZero() {
+		opts = append(opts, isuexporter.WithTimeWindow(sinceTime, untilTime))
+	}
+	for key, value := range attrs {
+		opts = append(opts, isuexporter.WithAttributeMatcher(key, value))
+	}
+
+	file, err := os.Open(*filePath)
+	if err != nil {
+		return err
+	}
+	defer file.Close()
+
+	report, err := isuexporter.Analyze(file, opts...)
+	if err != nil {
+		return err
+	}
+
+	switch *format {
+	case "json":
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(report)
+	case "table", "":
+		return isuexporter.WriteTable(os.Stdout, report)
+	default:
+		return fmt.Errorf("unsupported -format: %q", *format)
+	}
+}
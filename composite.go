@@ -0,0 +1,82 @@
+package isuexporter
+
+import (
+	"context"
+	"errors"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/sdk/resource"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+)
+
+// CompositeSpanExporter は複数の SpanExporter へ同じスパンをファンアウトする。
+// 例えばローカルの JSON ファイルへのレース後分析用の出力と、OTLP コレクタへの
+// ライブダッシュボード向け送信を同時に行いたい場合に利用する。
+type CompositeSpanExporter struct {
+	exporters []sdktrace.SpanExporter
+}
+
+// NewCompositeSpanExporter は指定したすべての SpanExporter をまとめた
+// CompositeSpanExporter を作成する
+func NewCompositeSpanExporter(exporters ...sdktrace.SpanExporter) *CompositeSpanExporter {
+	return &CompositeSpanExporter{exporters: exporters}
+}
+
+// ExportSpans はすべての子エクスポータへスパンを送り、発生したエラーは
+// 1つ目で打ち切らずに errors.Join でまとめて返す
+func (c *CompositeSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	var errs []error
+	for _, exporter := range c.exporters {
+		if err := exporter.ExportSpans(ctx, spans); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// Shutdown はすべての子エクスポータを停止する。個々の失敗は記録しつつ
+// 他のエクスポータの Shutdown も必ず呼び出す
+func (c *CompositeSpanExporter) Shutdown(ctx context.Context) error {
+	var errs []error
+	for _, exporter := range c.exporters {
+		if err := exporter.Shutdown(ctx); err != nil {
+			errs = append(errs, err)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// TraceMultiProvider は複数のエクスポータを CompositeSpanExporter でまとめ、
+// TraceFileProvider と同じクリーンアップ契約(呼び出し側がdeferするfunc())で
+// TracerProvider を登録するヘルパー
+func TraceMultiProvider(serviceName string, serviceVersion string, exporters ...sdktrace.SpanExporter) (func(), error) {
+	composite := NewCompositeSpanExporter(exporters...)
+
+	otelResource := resource.NewWithAttributes(
+		semconv.SchemaURL,
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(serviceVersion),
+	)
+
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithBatcher(composite),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+		sdktrace.WithResource(otelResource),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	// TraceFileProviderと同様に、負荷生成ツールからのトレースコンテキストを
+	// 引き継げるよう tracecontext+baggage+b3 のコンポジットPropagatorを登録する
+	otel.SetTextMapPropagator(defaultPropagator())
+
+	cleanup := func() {
+		ctx, cancel := context.WithCancel(context.Background())
+		defer cancel()
+		err := tracerProvider.Shutdown(ctx)
+		if err != nil {
+			return
+		}
+	}
+	return cleanup, nil
+}
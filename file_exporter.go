@@ -0,0 +1,381 @@
+package isuexporter
+
+import (
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// fileExporterConfig は FileSpanExporter の出力形式・ローテーション設定を保持する
+type fileExporterConfig struct {
+	otlpJSON bool
+	compress bool
+	maxBytes int64
+	maxAge   time.Duration
+}
+
+// FileExporterOption は NewFileSpanExporter に渡す設定用の関数オプション
+type FileExporterOption func(*fileExporterConfig)
+
+// WithOTLPJSONFormat は spanToMap の簡易フォーマットの代わりに、OTLP/JSON
+// 互換の ResourceSpans スキーマでスパンを書き出すようにする。otel-cli や
+// コレクタの filelog receiver でそのまま読み込めるようにするためのオプション。
+func WithOTLPJSONFormat() FileExporterOption {
+	return func(c *fileExporterConfig) {
+		c.otlpJSON = true
+	}
+}
+
+// WithGzipCompression はローテーションされた過去ファイル(file.jsonl.1 以降)を
+// gzip 圧縮して保存するようにする
+func WithGzipCompression() FileExporterOption {
+	return func(c *fileExporterConfig) {
+		c.compress = true
+	}
+}
+
+// WithMaxFileSize はアクティブなファイルがこのバイト数を超えたタイミングで
+// ローテーションするようにする。0 以下を指定するとサイズによるローテーションは行わない
+func WithMaxFileSize(maxBytes int64) FileExporterOption {
+	return func(c *fileExporterConfig) {
+		c.maxBytes = maxBytes
+	}
+}
+
+// WithMaxFileAge はアクティブなファイルを開いてからこの時間が経過したタイミングで
+// ローテーションするようにする。0 を指定すると時間によるローテーションは行わない
+func WithMaxFileAge(maxAge time.Duration) FileExporterOption {
+	return func(c *fileExporterConfig) {
+		c.maxAge = maxAge
+	}
+}
+
+// FileSpanExporter はスパンを1行1スパンの NDJSON としてファイルへ書き出す
+// SpanExporter。サイズ/時間ベースのローテーションと gzip 圧縮に対応する。
+type FileSpanExporter struct {
+	mu sync.Mutex
+
+	basePath string
+	cfg      fileExporterConfig
+
+	file          *os.File
+	written       int64
+	openedAt      time.Time
+	rotationCount int
+}
+
+// NewFileSpanExporter は filename をアクティブな出力先として FileSpanExporter を作成する
+func NewFileSpanExporter(filename string, opts ...FileExporterOption) (*FileSpanExporter, error) {
+	f := &FileSpanExporter{basePath: filename}
+	for _, opt := range opts {
+		opt(&f.cfg)
+	}
+	if err := f.openActiveFile(); err != nil {
+		return nil, err
+	}
+	return f, nil
+}
+
+func (f *FileSpanExporter) openActiveFile() error {
+	file, err := os.Create(f.basePath)
+	if err != nil {
+		return err
+	}
+	f.file = file
+	f.written = 0
+	f.openedAt = time.Now()
+	return nil
+}
+
+func (f *FileSpanExporter) Shutdown(ctx context.Context) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.file.Close()
+}
+
+// ExportSpans メソッドを実装（SpanExporter インターフェースを満たす）
+func (f *FileSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+
+	for _, span := range spans {
+		var payload interface{}
+		if f.cfg.otlpJSON {
+			payload = spanToOTLP(span)
+		} else {
+			payload = spanToMap(span)
+		}
+
+		// NDJSON: 1スパン1行。MarshalIndent はストリーミング読み込みと相性が悪いため使わない
+		data, err := json.Marshal(payload)
+		if err != nil {
+			return err
+		}
+		data = append(data, '\n')
+
+		if err := f.rotateIfNeeded(int64(len(data))); err != nil {
+			return err
+		}
+
+		n, err := f.file.Write(data)
+		if err != nil {
+			return err
+		}
+		f.written += int64(n)
+	}
+	return nil
+}
+
+// rotateIfNeeded は次に書き込む nextWrite バイトを加味して、サイズまたは経過時間の
+// 閾値を超えていればアクティブファイルをローテーションする
+func (f *FileSpanExporter) rotateIfNeeded(nextWrite int64) error {
+	sizeExceeded := f.cfg.maxBytes > 0 && f.written+nextWrite > f.cfg.maxBytes
+	ageExceeded := f.cfg.maxAge > 0 && time.Since(f.openedAt) > f.cfg.maxAge
+	if !sizeExceeded && !ageExceeded {
+		return nil
+	}
+	return f.rotate()
+}
+
+// rotate はアクティブファイルを file.jsonl.N (必要なら .gz を付与)へ退避し、
+// 新しいアクティブファイルを開き直す
+func (f *FileSpanExporter) rotate() error {
+	if err := f.file.Close(); err != nil {
+		return err
+	}
+	f.rotationCount++
+
+	rotatedPath := fmt.Sprintf("%s.%d", f.basePath, f.rotationCount)
+	if err := os.Rename(f.basePath, rotatedPath); err != nil {
+		return err
+	}
+
+	if f.cfg.compress {
+		if err := compressFile(rotatedPath, rotatedPath+".gz"); err != nil {
+			return err
+		}
+		if err := os.Remove(rotatedPath); err != nil {
+			return err
+		}
+	}
+
+	return f.openActiveFile()
+}
+
+// compressFile は src を gzip 圧縮して dst に書き出す
+func compressFile(src, dst string) error {
+	in, err := os.Open(src)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	defer out.Close()
+
+	gw := gzip.NewWriter(out)
+	if _, err := io.Copy(gw, in); err != nil {
+		return err
+	}
+	return gw.Close()
+}
+
+// ReadOnlySpan から簡易なマップに変換する。spanToOTLP と異なり、ファイルの中身を
+// 直接目視確認する用途を想定した読みやすいキー名にしている。
+func spanToMap(span sdktrace.ReadOnlySpan) map[string]interface{} {
+	spanCtx := span.SpanContext()
+	parentCtx := span.Parent()
+
+	m := map[string]interface{}{
+		"name":       span.Name(),
+		"traceID":    spanCtx.TraceID().String(),
+		"spanID":     spanCtx.SpanID().String(),
+		"kind":       span.SpanKind().String(),
+		"startTime":  span.StartTime(),
+		"endTime":    span.EndTime(),
+		"attributes": span.Attributes(),
+		"status": map[string]interface{}{
+			"code":        span.Status().Code.String(),
+			"description": span.Status().Description,
+		},
+		"events": span.Events(),
+		"links":  span.Links(),
+	}
+	if parentCtx.IsValid() {
+		m["parentSpanID"] = parentCtx.SpanID().String()
+	}
+	return m
+}
+
+// otlpKeyValue は OTLP/JSON の KeyValue メッセージに対応する
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+// otlpAnyValue は OTLP/JSON の AnyValue メッセージに対応する。プロトコルの
+// oneof を JSON で表現するため、使用しないフィールドは omitempty で落とす。
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *string  `json:"intValue,omitempty"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func attributeToKeyValue(kv attribute.KeyValue) otlpKeyValue {
+	av := otlpAnyValue{}
+	switch kv.Value.Type() {
+	case attribute.BOOL:
+		b := kv.Value.AsBool()
+		av.BoolValue = &b
+	case attribute.INT64:
+		s := fmt.Sprintf("%d", kv.Value.AsInt64())
+		av.IntValue = &s
+	case attribute.FLOAT64:
+		d := kv.Value.AsFloat64()
+		av.DoubleValue = &d
+	default:
+		s := kv.Value.Emit()
+		av.StringValue = &s
+	}
+	return otlpKeyValue{Key: string(kv.Key), Value: av}
+}
+
+func attributesToKeyValues(attrs []attribute.KeyValue) []otlpKeyValue {
+	if len(attrs) == 0 {
+		return nil
+	}
+	kvs := make([]otlpKeyValue, 0, len(attrs))
+	for _, attr := range attrs {
+		kvs = append(kvs, attributeToKeyValue(attr))
+	}
+	return kvs
+}
+
+type otlpEvent struct {
+	TimeUnixNano string         `json:"timeUnixNano"`
+	Name         string         `json:"name"`
+	Attributes   []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpLink struct {
+	TraceID    string         `json:"traceId"`
+	SpanID     string         `json:"spanId"`
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpStatus struct {
+	Code    int    `json:"code"`
+	Message string `json:"message,omitempty"`
+}
+
+type otlpSpan struct {
+	TraceID           string         `json:"traceId"`
+	SpanID            string         `json:"spanId"`
+	ParentSpanID      string         `json:"parentSpanId,omitempty"`
+	Name              string         `json:"name"`
+	Kind              int            `json:"kind"`
+	StartTimeUnixNano string         `json:"startTimeUnixNano"`
+	EndTimeUnixNano   string         `json:"endTimeUnixNano"`
+	Attributes        []otlpKeyValue `json:"attributes,omitempty"`
+	Events            []otlpEvent    `json:"events,omitempty"`
+	Links             []otlpLink     `json:"links,omitempty"`
+	Status            otlpStatus     `json:"status"`
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+type otlpScopeSpans struct {
+	Scope otlpScope  `json:"scope"`
+	Spans []otlpSpan `json:"spans"`
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes,omitempty"`
+}
+
+type otlpResourceSpans struct {
+	Resource   otlpResource     `json:"resource"`
+	ScopeSpans []otlpScopeSpans `json:"scopeSpans"`
+}
+
+// statusCodeToOTLP は sdktrace/codes の Status.Code を OTLP の
+// Status.code 数値表現(UNSET=0, OK=1, ERROR=2)へ変換する
+func statusCodeToOTLP(code codes.Code) int {
+	switch code {
+	case codes.Ok:
+		return 1
+	case codes.Error:
+		return 2
+	default:
+		return 0
+	}
+}
+
+// spanToOTLP は ReadOnlySpan を OTLP/JSON の ResourceSpans 1件分に変換する。
+// trace/span ID、parent、status、kind、events、links を含め、otel-cli や
+// コレクタの filelog receiver でそのまま取り込める形にする。
+func spanToOTLP(span sdktrace.ReadOnlySpan) otlpResourceSpans {
+	spanCtx := span.SpanContext()
+
+	events := make([]otlpEvent, 0, len(span.Events()))
+	for _, event := range span.Events() {
+		events = append(events, otlpEvent{
+			TimeUnixNano: fmt.Sprintf("%d", event.Time.UnixNano()),
+			Name:         event.Name,
+			Attributes:   attributesToKeyValues(event.Attributes),
+		})
+	}
+
+	links := make([]otlpLink, 0, len(span.Links()))
+	for _, link := range span.Links() {
+		links = append(links, otlpLink{
+			TraceID:    link.SpanContext.TraceID().String(),
+			SpanID:     link.SpanContext.SpanID().String(),
+			Attributes: attributesToKeyValues(link.Attributes),
+		})
+	}
+
+	otlpSp := otlpSpan{
+		TraceID:           spanCtx.TraceID().String(),
+		SpanID:            spanCtx.SpanID().String(),
+		Name:              span.Name(),
+		Kind:              int(span.SpanKind()),
+		StartTimeUnixNano: fmt.Sprintf("%d", span.StartTime().UnixNano()),
+		EndTimeUnixNano:   fmt.Sprintf("%d", span.EndTime().UnixNano()),
+		Attributes:        attributesToKeyValues(span.Attributes()),
+		Events:            events,
+		Links:             links,
+		Status: otlpStatus{
+			Code:    statusCodeToOTLP(span.Status().Code),
+			Message: span.Status().Description,
+		},
+	}
+	if parent := span.Parent(); parent.IsValid() {
+		otlpSp.ParentSpanID = parent.SpanID().String()
+	}
+
+	return otlpResourceSpans{
+		Resource: otlpResource{Attributes: attributesToKeyValues(span.Resource().Attributes())},
+		ScopeSpans: []otlpScopeSpans{
+			{
+				Scope: otlpScope{Name: span.InstrumentationScope().Name},
+				Spans: []otlpSpan{otlpSp},
+			},
+		},
+	}
+}
@@ -2,58 +2,77 @@ package isuexporter
 
 import (
 	"context"
-	"encoding/json"
+
 	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
 	"go.opentelemetry.io/otel/sdk/resource"
 	sdktrace "go.opentelemetry.io/otel/sdk/trace"
 	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
-	"os"
 )
 
-type FileSpanExporter struct {
-	file *os.File
-}
+// TraceFileProvider は filePath に書き出す FileSpanExporter を使う TracerProvider を
+// 構築し、グローバルに登録する。opts でサンプラーやバッチ設定、追加の
+// SpanProcessor、リソース属性、Propagator を調整できる。
+func TraceFileProvider(filePath string, serviceName string, serviceVersion string, opts ...TraceFileProviderOption) (func(), error) {
+	// otelのライブラリではexporterという枠組みで計測した情報をどこに送信するかを設定できる
+	// 今回はファイルに出力するためのexporterを作成する
 
-func NewFileSpanExporter(filename string) (*FileSpanExporter, error) {
-	file, err := os.Create(filename)
-	if err != nil {
-		return nil, err
+	cfg := &traceFileProviderConfig{
+		sampler: sdktrace.AlwaysSample(),
+	}
+	for _, opt := range opts {
+		opt(cfg)
 	}
-	return &FileSpanExporter{file: file}, nil
-}
-
-func (f *FileSpanExporter) Shutdown(ctx context.Context) error {
-	return f.file.Close()
-}
-
-func TraceFileProvider(filePath string, serviceName string, serviceVersion string) (func(), error) {
-	// otelのライブラリではexporterという枠組みで計測した情報をどこに送信するかを設定できる
-	// 今回は標準出力(stderr)に出力するためのexporterを作成する
 
-	exporter, err := NewFileSpanExporter(filePath)
+	exporter, err := NewFileSpanExporter(filePath, cfg.fileExporterOpts...)
 
 	if err != nil {
 		// exporterの作成に失敗した場合のエラー処理
+		return nil, err
 	}
 
 	// リソースは、OpenTelemetryのデータに付加するメタデータを定義する
-	// ここでは、スキーマURL、サービス名、サービスバージョンをメタデータとして設定している
-	otelResource := resource.NewWithAttributes(
-		semconv.SchemaURL,                                // スキーマURLを設定
-		semconv.ServiceNameKey.String(serviceName),       // サービス名を設定
-		semconv.ServiceVersionKey.String(serviceVersion), // サービスバージョンを設定
-	)
+	// ここでは、スキーマURL、サービス名、サービスバージョンに加えて
+	// WithResourceAttributes で渡された追加属性をメタデータとして設定している
+	resourceAttrs := append([]attribute.KeyValue{
+		semconv.ServiceNameKey.String(serviceName),
+		semconv.ServiceVersionKey.String(serviceVersion),
+	}, cfg.resourceAttributes...)
+	otelResource := resource.NewWithAttributes(semconv.SchemaURL, resourceAttrs...)
+
+	batcherOpts := []sdktrace.BatchSpanProcessorOption{}
+	if cfg.batchTimeout > 0 {
+		batcherOpts = append(batcherOpts, sdktrace.WithBatchTimeout(cfg.batchTimeout))
+	}
+	if cfg.maxQueueSize > 0 {
+		batcherOpts = append(batcherOpts, sdktrace.WithMaxQueueSize(cfg.maxQueueSize))
+	}
+	if cfg.maxExportBatchSize > 0 {
+		batcherOpts = append(batcherOpts, sdktrace.WithMaxExportBatchSize(cfg.maxExportBatchSize))
+	}
 
 	// TracerProviderはOpenTelemetryのトレースデータを処理するコンポーネント
-	// ここでは、作成したexporterとリソースを設定している
+	// ここでは、作成したexporterとリソース、サンプラーを設定している
 	tracerProvider := sdktrace.NewTracerProvider(
-		sdktrace.WithBatcher(exporter),                // 作成したexporterを設定
-		sdktrace.WithSampler(sdktrace.AlwaysSample()), // すべてのスパンをサンプリングする
-		sdktrace.WithResource(otelResource),           // 設定したリソースを適用
+		sdktrace.WithBatcher(exporter, batcherOpts...), // 作成したexporterを設定
+		sdktrace.WithSampler(cfg.sampler),              // 指定されたサンプラーでサンプリングする
+		sdktrace.WithResource(otelResource),            // 設定したリソースを適用
 	)
+	for _, sp := range cfg.extraProcessors {
+		tracerProvider.RegisterSpanProcessor(sp)
+	}
+
 	// TracerProviderをOpenTelemetryのグローバル設定に登録する
 	otel.SetTracerProvider(tracerProvider)
 
+	// 負荷生成ツールからのリクエストがトレースコンテキストを引き継げるよう、
+	// tracecontext+baggage+b3 のコンポジットPropagatorを登録する
+	propagator := cfg.propagator
+	if propagator == nil {
+		propagator = defaultPropagator()
+	}
+	otel.SetTextMapPropagator(propagator)
+
 	// TracerProviderの終了処理を行う関数を作成する
 	cleanup := func() {
 		ctx, cancel := context.WithCancel(context.Background()) // コンテキストを作成
@@ -67,29 +86,3 @@ func TraceFileProvider(filePath string, serviceName string, serviceVersion strin
 	// これにより、TracerProviderがクリーンアップされ、リソースが適切に解放される
 	return cleanup, nil
 }
-
-// ExportSpans メソッドを実装（SpanExporter インターフェースを満たす）
-func (f *FileSpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
-	for _, span := range spans {
-		// スパンデータを JSON 形式で出力
-		data, err := json.MarshalIndent(spanToMap(span), "", "  ")
-		if err != nil {
-			return err
-		}
-		_, err = f.file.Write(append(data, '\n'))
-		if err != nil {
-			return err
-		}
-	}
-	return nil
-}
-
-// ReadOnlySpan から簡易なマップに変換する（必要に応じてカスタマイズ可能）
-func spanToMap(span sdktrace.ReadOnlySpan) map[string]interface{} {
-	return map[string]interface{}{
-		"name":       span.Name(),
-		"startTime":  span.StartTime(),
-		"endTime":    span.EndTime(),
-		"attributes": span.Attributes(),
-	}
-}
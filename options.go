@@ -0,0 +1,102 @@
+package isuexporter
+
+import (
+	"time"
+
+	"go.opentelemetry.io/contrib/propagators/b3"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/propagation"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// traceFileProviderConfig は TraceFileProvider の挙動を細かく調整するための設定値
+type traceFileProviderConfig struct {
+	sampler            sdktrace.Sampler
+	batchTimeout       time.Duration
+	maxQueueSize       int
+	maxExportBatchSize int
+	extraProcessors    []sdktrace.SpanProcessor
+	resourceAttributes []attribute.KeyValue
+	propagator         propagation.TextMapPropagator
+	fileExporterOpts   []FileExporterOption
+}
+
+// TraceFileProviderOption は TraceFileProvider に渡す設定用の関数オプション
+type TraceFileProviderOption func(*traceFileProviderConfig)
+
+// WithSampler はデフォルトの AlwaysSample の代わりに使うサンプラーを指定する。
+// 高RPSなISUCONシナリオでは ParentBasedTraceIDRatio と組み合わせて間引く想定
+func WithSampler(sampler sdktrace.Sampler) TraceFileProviderOption {
+	return func(c *traceFileProviderConfig) {
+		c.sampler = sampler
+	}
+}
+
+// WithBatchTimeout はバッチプロセッサがスパンをエクスポートするまでの最大待機時間を設定する
+func WithBatchTimeout(d time.Duration) TraceFileProviderOption {
+	return func(c *traceFileProviderConfig) {
+		c.batchTimeout = d
+	}
+}
+
+// WithMaxQueueSize はバッチプロセッサが保持できる未エクスポートスパンの最大数を設定する
+func WithMaxQueueSize(n int) TraceFileProviderOption {
+	return func(c *traceFileProviderConfig) {
+		c.maxQueueSize = n
+	}
+}
+
+// WithMaxExportBatchSize は1回のエクスポートでまとめて送るスパンの最大数を設定する
+func WithMaxExportBatchSize(n int) TraceFileProviderOption {
+	return func(c *traceFileProviderConfig) {
+		c.maxExportBatchSize = n
+	}
+}
+
+// WithSpanProcessor はバッチプロセッサに加えて追加の SpanProcessor を登録する
+func WithSpanProcessor(sp sdktrace.SpanProcessor) TraceFileProviderOption {
+	return func(c *traceFileProviderConfig) {
+		c.extraProcessors = append(c.extraProcessors, sp)
+	}
+}
+
+// WithResourceAttributes はサービス名/バージョンに加えてリソースへ付与する属性を追加する
+func WithResourceAttributes(attrs ...attribute.KeyValue) TraceFileProviderOption {
+	return func(c *traceFileProviderConfig) {
+		c.resourceAttributes = append(c.resourceAttributes, attrs...)
+	}
+}
+
+// WithFileExporterOptions は内部で作る FileSpanExporter にそのまま渡す
+// オプションを指定する。isuexporter-analyze で読める OTLP/JSON 形式にしたい場合は
+// WithFileExporterOptions(WithOTLPJSONFormat()) を渡す。
+func WithFileExporterOptions(opts ...FileExporterOption) TraceFileProviderOption {
+	return func(c *traceFileProviderConfig) {
+		c.fileExporterOpts = append(c.fileExporterOpts, opts...)
+	}
+}
+
+// WithPropagator はデフォルトの tracecontext+baggage+b3 コンポジットの代わりに
+// 使う TextMapPropagator を指定する
+func WithPropagator(p propagation.TextMapPropagator) TraceFileProviderOption {
+	return func(c *traceFileProviderConfig) {
+		c.propagator = p
+	}
+}
+
+// ParentBasedTraceIDRatio は親スパンのサンプリング判断を尊重しつつ、ルートスパンは
+// ratio の割合でサンプリングするサンプラーを返す。高RPSな負荷走行でスパン量を
+// 間引きたい場合に WithSampler と組み合わせて使う。
+func ParentBasedTraceIDRatio(ratio float64) sdktrace.Sampler {
+	return sdktrace.ParentBased(sdktrace.TraceIDRatioBased(ratio))
+}
+
+// defaultPropagator は負荷生成ツールから渡されるトレースコンテキストを
+// 受け継げるよう、tracecontext・baggage・b3 を束ねたコンポジットを返す
+func defaultPropagator() propagation.TextMapPropagator {
+	return propagation.NewCompositeTextMapPropagator(
+		propagation.TraceContext{},
+		propagation.Baggage{},
+		b3.New(),
+	)
+}
@@ -0,0 +1,50 @@
+package otelhttp
+
+import (
+	"net/http"
+
+	"github.com/labstack/echo/v4"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// EchoMiddleware は echo.Echo.Use に渡すミドルウェアを返す。ルートテンプレートは
+// echo がルーティング後に埋める c.Path() をそのまま使うため、/users/:id のような
+// パラメータ化されたルートで属性が発散しない。
+func EchoMiddleware(opts ...Option) echo.MiddlewareFunc {
+	cfg := newConfig(opts)
+	tracer := cfg.tracer()
+
+	return func(next echo.HandlerFunc) echo.HandlerFunc {
+		return func(c echo.Context) error {
+			route := c.Path()
+			if route == "" {
+				route = c.Request().URL.Path
+			}
+
+			ctx, span := tracer.Start(c.Request().Context(), route,
+				oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+				oteltrace.WithAttributes(
+					semconv.HTTPMethodKey.String(c.Request().Method),
+					semconv.HTTPRouteKey.String(route),
+				),
+			)
+			defer span.End()
+			c.SetRequest(c.Request().WithContext(ctx))
+
+			err := next(c)
+
+			status := c.Response().Status
+			span.SetAttributes(semconv.HTTPStatusCodeKey.Int(status))
+			switch {
+			case err != nil:
+				span.RecordError(err)
+				span.SetStatus(codes.Error, err.Error())
+			case status >= http.StatusInternalServerError:
+				span.SetStatus(codes.Error, http.StatusText(status))
+			}
+			return err
+		}
+	}
+}
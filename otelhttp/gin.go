@@ -0,0 +1,47 @@
+package otelhttp
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+// GinMiddleware は gin.Engine.Use に渡すミドルウェアを返す。ルートテンプレートは
+// ルーティング後にしか確定しないため、スパン終了直前に c.FullPath() から取得する。
+func GinMiddleware(opts ...Option) gin.HandlerFunc {
+	cfg := newConfig(opts)
+	tracer := cfg.tracer()
+
+	return func(c *gin.Context) {
+		ctx, span := tracer.Start(c.Request.Context(), c.Request.URL.Path,
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(
+				semconv.HTTPMethodKey.String(c.Request.Method),
+			),
+		)
+		defer span.End()
+		c.Request = c.Request.WithContext(ctx)
+
+		c.Next()
+
+		route := c.FullPath()
+		if route == "" {
+			route = c.Request.URL.Path
+		}
+		span.SetName(route)
+		span.SetAttributes(
+			semconv.HTTPRouteKey.String(route),
+			semconv.HTTPStatusCodeKey.Int(c.Writer.Status()),
+		)
+
+		if len(c.Errors) > 0 {
+			span.RecordError(c.Errors.Last())
+			span.SetStatus(codes.Error, c.Errors.Last().Error())
+		} else if c.Writer.Status() >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(c.Writer.Status()))
+		}
+	}
+}
@@ -0,0 +1,71 @@
+package otelhttp
+
+import (
+	"database/sql"
+	"database/sql/driver"
+	"fmt"
+
+	"github.com/gin-gonic/gin"
+	"github.com/labstack/echo/v4"
+	"github.com/mikanbox/isuexporter"
+	"github.com/mikanbox/isuexporter/otelsql"
+)
+
+// ISUCONConfig は RegisterISUCON に渡す設定値。Driver を指定しなかった場合、
+// SQL の計測は行わずHTTPミドルウェアとTraceFileProviderだけを組み込む。
+type ISUCONConfig struct {
+	ServiceName    string
+	ServiceVersion string
+	FilePath       string // 未指定時は "trace.jsonl"
+
+	// OTLPJSON を true にすると、isuexporter-analyze でそのまま読める
+	// OTLP/JSON スキーマでファイルを書き出す。false の場合は目視向けの
+	// spanToMap 形式になる。
+	OTLPJSON bool
+
+	DriverName string
+	Driver     driver.Driver
+	DSN        string
+}
+
+// RegisterISUCON は TraceFileProvider、app (*echo.Echo または *gin.Engine) への
+// HTTPミドルウェア、otelsqlでラップした*sql.DBの3つを1回の呼び出しで組み込む。
+// ISUCONの参考実装にわずかな行数でエンドポイント/クエリ単位のレイテンシ計測を
+// 追加できるようにするためのエントリポイント。
+func RegisterISUCON(app interface{}, cfg ISUCONConfig) (*sql.DB, func(), error) {
+	filePath := cfg.FilePath
+	if filePath == "" {
+		filePath = "trace.jsonl"
+	}
+
+	var providerOpts []isuexporter.TraceFileProviderOption
+	if cfg.OTLPJSON {
+		providerOpts = append(providerOpts, isuexporter.WithFileExporterOptions(isuexporter.WithOTLPJSONFormat()))
+	}
+
+	cleanup, err := isuexporter.TraceFileProvider(filePath, cfg.ServiceName, cfg.ServiceVersion, providerOpts...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	switch a := app.(type) {
+	case *echo.Echo:
+		a.Use(EchoMiddleware())
+	case *gin.Engine:
+		a.Use(GinMiddleware())
+	default:
+		cleanup()
+		return nil, nil, fmt.Errorf("otelhttp: unsupported app type %T", app)
+	}
+
+	if cfg.Driver == nil {
+		return nil, cleanup, nil
+	}
+
+	db, err := otelsql.Open(cfg.DriverName, cfg.Driver, cfg.DSN, otelsql.WithDBSystem(cfg.DriverName))
+	if err != nil {
+		cleanup()
+		return nil, nil, err
+	}
+	return db, cleanup, nil
+}
@@ -0,0 +1,97 @@
+// Package otelhttp provides net/http (and echo/gin) middleware that creates a
+// server span per request with route template, method, and status code
+// attributes, so ISUCON-style reference implementations get per-endpoint
+// latency in the spans isuexporter writes out.
+package otelhttp
+
+import (
+	"net/http"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/mikanbox/isuexporter/otelhttp"
+
+// config はミドルウェア共通の設定値を保持する
+type config struct {
+	routeTemplate  func(*http.Request) string
+	tracerProvider oteltrace.TracerProvider
+}
+
+// Option はミドルウェアの生成に渡す関数オプション
+type Option func(*config)
+
+// WithRouteTemplate はスパン名/http.routeに使うルートテンプレートの抽出方法を指定する。
+// 未指定の場合は r.URL.Path をそのまま使う。
+func WithRouteTemplate(f func(*http.Request) string) Option {
+	return func(c *config) {
+		c.routeTemplate = f
+	}
+}
+
+// WithTracerProvider はデフォルトの otel.GetTracerProvider() の代わりに使う
+// TracerProvider を指定する
+func WithTracerProvider(tp oteltrace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+func newConfig(opts []Option) *config {
+	cfg := &config{
+		routeTemplate: func(r *http.Request) string { return r.URL.Path },
+	}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func (c *config) tracer() oteltrace.Tracer {
+	tp := c.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+// statusRecorder は next.ServeHTTP が呼んだ WriteHeader のステータスコードを記録する
+type statusRecorder struct {
+	http.ResponseWriter
+	status int
+}
+
+func (r *statusRecorder) WriteHeader(code int) {
+	r.status = code
+	r.ResponseWriter.WriteHeader(code)
+}
+
+// Middleware は net/http ハンドラをラップし、リクエストごとにサーバスパンを作る
+func Middleware(next http.Handler, opts ...Option) http.Handler {
+	cfg := newConfig(opts)
+	tracer := cfg.tracer()
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		route := cfg.routeTemplate(r)
+		ctx, span := tracer.Start(r.Context(), route,
+			oteltrace.WithSpanKind(oteltrace.SpanKindServer),
+			oteltrace.WithAttributes(
+				semconv.HTTPMethodKey.String(r.Method),
+				semconv.HTTPRouteKey.String(route),
+				semconv.HTTPTargetKey.String(r.URL.Path),
+			),
+		)
+		defer span.End()
+
+		rec := &statusRecorder{ResponseWriter: w, status: http.StatusOK}
+		next.ServeHTTP(rec, r.WithContext(ctx))
+
+		span.SetAttributes(semconv.HTTPStatusCodeKey.Int(rec.status))
+		if rec.status >= http.StatusInternalServerError {
+			span.SetStatus(codes.Error, http.StatusText(rec.status))
+		}
+	})
+}
@@ -0,0 +1,411 @@
+// Package otelsql wraps a database/sql/driver.Driver so every query run
+// through it produces a client span with the SQL statement text, rows
+// affected, and duration, letting ISUCON contestants see per-query latency
+// in the spans isuexporter writes out.
+package otelsql
+
+import (
+	"context"
+	"database/sql"
+	"database/sql/driver"
+	"io"
+	"sync"
+	"time"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.7.0"
+	oteltrace "go.opentelemetry.io/otel/trace"
+)
+
+const tracerName = "github.com/mikanbox/isuexporter/otelsql"
+
+// Sanitizer はスパンに記録する前に SQL 文を加工する。バインドパラメータの
+// マスキングや長大なIN句の省略など、そのまま出したくない文字列を変換するために使う。
+type Sanitizer func(query string) string
+
+// config は otelDriver/otelConn/otelStmt 共通の設定値を保持する
+type config struct {
+	tracerProvider oteltrace.TracerProvider
+	sanitizer      Sanitizer
+	dbSystem       string
+}
+
+// Option は Register/Open に渡す関数オプション
+type Option func(*config)
+
+// WithTracerProvider はデフォルトの otel.GetTracerProvider() の代わりに使う
+// TracerProvider を指定する
+func WithTracerProvider(tp oteltrace.TracerProvider) Option {
+	return func(c *config) {
+		c.tracerProvider = tp
+	}
+}
+
+// WithSanitizer はスパンに記録するSQL文を加工するサニタイザーを指定する
+func WithSanitizer(s Sanitizer) Option {
+	return func(c *config) {
+		c.sanitizer = s
+	}
+}
+
+// WithDBSystem は db.system 属性に設定する値(mysql, postgresql など)を指定する
+func WithDBSystem(system string) Option {
+	return func(c *config) {
+		c.dbSystem = system
+	}
+}
+
+func newConfig(dbSystem string, opts []Option) *config {
+	cfg := &config{dbSystem: dbSystem}
+	for _, opt := range opts {
+		opt(cfg)
+	}
+	return cfg
+}
+
+func (c *config) tracer() oteltrace.Tracer {
+	tp := c.tracerProvider
+	if tp == nil {
+		tp = otel.GetTracerProvider()
+	}
+	return tp.Tracer(tracerName)
+}
+
+func (c *config) statement(query string) string {
+	if c.sanitizer == nil {
+		return query
+	}
+	return c.sanitizer(query)
+}
+
+var (
+	registeredMu sync.Mutex
+	registered   = map[string]bool{}
+)
+
+// Register はdriverImplをスパン計測付きでラップし、driverName+"+otelsql" という
+// 新しい名前でdatabase/sqlへ登録してその名前を返す。同じdriverNameに対して
+// 複数回呼ばれても database/sql.Register は1回しか呼ばない。sql.Register は
+// 同名での2度目の呼び出しでpanicするため、複数の*sql.DBを開く呼び出し元や
+// テストで繰り返しRegister/Open/RegisterISUCONを呼んでもクラッシュしない。
+func Register(driverName string, driverImpl driver.Driver, opts ...Option) string {
+	cfg := newConfig(driverName, opts)
+	wrappedName := driverName + "+otelsql"
+
+	registeredMu.Lock()
+	defer registeredMu.Unlock()
+	if !registered[wrappedName] {
+		sql.Register(wrappedName, &otelDriver{driver: driverImpl, cfg: cfg})
+		registered[wrappedName] = true
+	}
+	return wrappedName
+}
+
+// Open はdriverImplをRegisterした上でsql.Openし、計測済みの*sql.DBを返す
+func Open(driverName string, driverImpl driver.Driver, dsn string, opts ...Option) (*sql.DB, error) {
+	wrappedName := Register(driverName, driverImpl, opts...)
+	return sql.Open(wrappedName, dsn)
+}
+
+type otelDriver struct {
+	driver driver.Driver
+	cfg    *config
+}
+
+func (d *otelDriver) Open(dsn string) (driver.Conn, error) {
+	conn, err := d.driver.Open(dsn)
+	if err != nil {
+		return nil, err
+	}
+	return wrapConn(conn, d.cfg), nil
+}
+
+// otelConn は driver.Conn を埋め込み、context対応のメソッドだけスパンを足して
+// 差し替える。埋め込んだ元のConnが対応インターフェースを実装していない場合は
+// driver.ErrSkip を返し、database/sql に非context版へのフォールバックを促す。
+type otelConn struct {
+	driver.Conn
+	cfg *config
+}
+
+// CheckNamedValue は元のConnがdriver.NamedValueCheckerを実装していればそれに
+// 委譲する。MySQLドライバ等はこれでuint64の高位ビット付き値のような、標準の
+// converterでは弾かれる型のバインドを許可しているため、ここで転送しないと
+// ラップした途端にクエリが壊れる。driver.ErrSkipを返せばdatabase/sqlが標準の
+// converterにフォールバックするので、未実装の場合でも安全。
+func (c *otelConn) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := c.Conn.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+// wrapConn は元のConnが実装する任意インターフェース(Pinger, SessionResetter,
+// Validator)の組み合わせに応じて、それらを転送する型を選んで返す。
+// database/sqlはconn.(driver.Pinger)のような型アサーションで対応の有無を
+// 確認するため、otelConnに常にこれらのメソッドを生やしてしまうと、元の
+// ドライバが対応していない場合まで対応していると誤認させてしまう。
+func wrapConn(conn driver.Conn, cfg *config) driver.Conn {
+	base := &otelConn{Conn: conn, cfg: cfg}
+	_, isPinger := conn.(driver.Pinger)
+	_, isResetter := conn.(driver.SessionResetter)
+	_, isValidator := conn.(driver.Validator)
+
+	switch {
+	case isPinger && isResetter && isValidator:
+		return struct {
+			*otelConn
+			connPinger
+			connSessionResetter
+			connValidator
+		}{base, connPinger{base}, connSessionResetter{base}, connValidator{base}}
+	case isPinger && isResetter:
+		return struct {
+			*otelConn
+			connPinger
+			connSessionResetter
+		}{base, connPinger{base}, connSessionResetter{base}}
+	case isPinger && isValidator:
+		return struct {
+			*otelConn
+			connPinger
+			connValidator
+		}{base, connPinger{base}, connValidator{base}}
+	case isResetter && isValidator:
+		return struct {
+			*otelConn
+			connSessionResetter
+			connValidator
+		}{base, connSessionResetter{base}, connValidator{base}}
+	case isPinger:
+		return struct {
+			*otelConn
+			connPinger
+		}{base, connPinger{base}}
+	case isResetter:
+		return struct {
+			*otelConn
+			connSessionResetter
+		}{base, connSessionResetter{base}}
+	case isValidator:
+		return struct {
+			*otelConn
+			connValidator
+		}{base, connValidator{base}}
+	default:
+		return base
+	}
+}
+
+type connPinger struct{ c *otelConn }
+
+func (p connPinger) Ping(ctx context.Context) error {
+	return p.c.Conn.(driver.Pinger).Ping(ctx)
+}
+
+type connSessionResetter struct{ c *otelConn }
+
+func (r connSessionResetter) ResetSession(ctx context.Context) error {
+	return r.c.Conn.(driver.SessionResetter).ResetSession(ctx)
+}
+
+type connValidator struct{ c *otelConn }
+
+func (v connValidator) IsValid() bool {
+	return v.c.Conn.(driver.Validator).IsValid()
+}
+
+func (c *otelConn) ExecContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := c.Conn.(driver.ExecerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := c.startSpan(ctx, query)
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, query, args)
+	c.finishSpan(span, start, result, err)
+	return result, err
+}
+
+func (c *otelConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := c.Conn.(driver.QueryerContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := c.startSpan(ctx, query)
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, query, args)
+	if err != nil {
+		finishQuerySpan(span, start, 0, err)
+		return nil, err
+	}
+	// 行のフェッチはCloseが呼ばれるまで続くため、ここではスパンを終了せず
+	// Rowsをラップして呼び出し側がCloseした時点で終了させる
+	return newOtelRows(rows, span, start), nil
+}
+
+func (c *otelConn) PrepareContext(ctx context.Context, query string) (driver.Stmt, error) {
+	var stmt driver.Stmt
+	var err error
+	if preparer, ok := c.Conn.(driver.ConnPrepareContext); ok {
+		stmt, err = preparer.PrepareContext(ctx, query)
+	} else {
+		stmt, err = c.Conn.Prepare(query)
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &otelStmt{Stmt: stmt, query: query, cfg: c.cfg}, nil
+}
+
+func (c *otelConn) startSpan(ctx context.Context, query string) (context.Context, oteltrace.Span) {
+	return c.cfg.tracer().Start(ctx, "db.query",
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(
+			semconv.DBSystemKey.String(c.cfg.dbSystem),
+			semconv.DBStatementKey.String(c.cfg.statement(query)),
+		),
+	)
+}
+
+func (c *otelConn) finishSpan(span oteltrace.Span, start time.Time, result driver.Result, err error) {
+	span.SetAttributes(attribute.Float64("db.duration_ms", float64(time.Since(start).Microseconds())/1000))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if result != nil {
+		if n, rerr := result.RowsAffected(); rerr == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		}
+	}
+	span.End()
+}
+
+// otelRows は driver.Rows を埋め込み、呼び出し側が行を読み終えて Close するまで
+// スパンを終了させない。Query系は ExecContext と違い Close されるまで本当の
+// 処理時間(行のフェッチ)が終わらないため、Close時点の経過時間と読み取った
+// 行数を db.duration_ms / db.rows_affected として記録する。
+// 呼び出し側がCloseを呼ばずに行を読み捨てるケース(スキャンエラーでの早期return等)
+// でスパンが永遠に終了しないのを防ぐため、Next()がio.EOFを返した時点でも
+// フォールバックとして終了させる。finishOnceによりCloseとの二重終了を防ぐ。
+type otelRows struct {
+	driver.Rows
+	span       oteltrace.Span
+	start      time.Time
+	rowCount   int64
+	finishOnce sync.Once
+}
+
+func newOtelRows(rows driver.Rows, span oteltrace.Span, start time.Time) *otelRows {
+	return &otelRows{Rows: rows, span: span, start: start}
+}
+
+func (r *otelRows) Next(dest []driver.Value) error {
+	err := r.Rows.Next(dest)
+	switch err {
+	case nil:
+		r.rowCount++
+	case io.EOF:
+		r.finish(nil)
+	}
+	return err
+}
+
+func (r *otelRows) Close() error {
+	err := r.Rows.Close()
+	r.finish(err)
+	return err
+}
+
+func (r *otelRows) finish(err error) {
+	r.finishOnce.Do(func() {
+		finishQuerySpan(r.span, r.start, r.rowCount, err)
+	})
+}
+
+// finishQuerySpan はクエリ系スパンの共通の終了処理。Execと異なりdriver.Rowsには
+// RowsAffectedが無いため、読み取った行数をそのままdb.rows_affectedとして使う。
+func finishQuerySpan(span oteltrace.Span, start time.Time, rowCount int64, err error) {
+	span.SetAttributes(
+		attribute.Float64("db.duration_ms", float64(time.Since(start).Microseconds())/1000),
+		attribute.Int64("db.rows_affected", rowCount),
+	)
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	}
+	span.End()
+}
+
+// otelStmt は driver.Stmt を埋め込み、PrepareContext経由で作られたステートメントの
+// 実行にもスパンを足す
+type otelStmt struct {
+	driver.Stmt
+	query string
+	cfg   *config
+}
+
+// CheckNamedValue はotelConnと同様、元のStmtがdriver.NamedValueCheckerを
+// 実装していればそれに委譲する
+func (s *otelStmt) CheckNamedValue(nv *driver.NamedValue) error {
+	if checker, ok := s.Stmt.(driver.NamedValueChecker); ok {
+		return checker.CheckNamedValue(nv)
+	}
+	return driver.ErrSkip
+}
+
+func (s *otelStmt) ExecContext(ctx context.Context, args []driver.NamedValue) (driver.Result, error) {
+	execer, ok := s.Stmt.(driver.StmtExecContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := s.startSpan(ctx)
+	start := time.Now()
+	result, err := execer.ExecContext(ctx, args)
+	s.finishSpan(span, start, result, err)
+	return result, err
+}
+
+func (s *otelStmt) QueryContext(ctx context.Context, args []driver.NamedValue) (driver.Rows, error) {
+	queryer, ok := s.Stmt.(driver.StmtQueryContext)
+	if !ok {
+		return nil, driver.ErrSkip
+	}
+
+	ctx, span := s.startSpan(ctx)
+	start := time.Now()
+	rows, err := queryer.QueryContext(ctx, args)
+	if err != nil {
+		finishQuerySpan(span, start, 0, err)
+		return nil, err
+	}
+	return newOtelRows(rows, span, start), nil
+}
+
+func (s *otelStmt) startSpan(ctx context.Context) (context.Context, oteltrace.Span) {
+	return s.cfg.tracer().Start(ctx, "db.query",
+		oteltrace.WithSpanKind(oteltrace.SpanKindClient),
+		oteltrace.WithAttributes(
+			semconv.DBSystemKey.String(s.cfg.dbSystem),
+			semconv.DBStatementKey.String(s.cfg.statement(s.query)),
+		),
+	)
+}
+
+func (s *otelStmt) finishSpan(span oteltrace.Span, start time.Time, result driver.Result, err error) {
+	span.SetAttributes(attribute.Float64("db.duration_ms", float64(time.Since(start).Microseconds())/1000))
+	if err != nil {
+		span.RecordError(err)
+		span.SetStatus(codes.Error, err.Error())
+	} else if result != nil {
+		if n, rerr := result.RowsAffected(); rerr == nil {
+			span.SetAttributes(attribute.Int64("db.rows_affected", n))
+		}
+	}
+	span.End()
+}
@@ -0,0 +1,112 @@
+package otelsql_test
+
+import (
+	"context"
+	"database/sql/driver"
+	"io"
+	"testing"
+
+	"github.com/mikanbox/isuexporter/otelsql"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+	"go.opentelemetry.io/otel/sdk/trace/tracetest"
+)
+
+// fakeDriver/fakeConn/fakeRows はdatabase/sql/driverを直接実装する最小限の
+// テスト用ドライバ。実DBには繋がず、otelsqlのラップ挙動だけを検証する。
+type fakeDriver struct{}
+
+func (fakeDriver) Open(dsn string) (driver.Conn, error) {
+	return &fakeConn{}, nil
+}
+
+type fakeConn struct{}
+
+func (c *fakeConn) Prepare(query string) (driver.Stmt, error) { return nil, driver.ErrSkip }
+func (c *fakeConn) Close() error                              { return nil }
+func (c *fakeConn) Begin() (driver.Tx, error)                 { return nil, driver.ErrSkip }
+
+func (c *fakeConn) QueryContext(ctx context.Context, query string, args []driver.NamedValue) (driver.Rows, error) {
+	return &fakeRows{rows: [][]driver.Value{{int64(1)}, {int64(2)}}}, nil
+}
+
+type fakeRows struct {
+	rows [][]driver.Value
+	pos  int
+}
+
+func (r *fakeRows) Columns() []string { return []string{"id"} }
+func (r *fakeRows) Close() error      { return nil }
+
+func (r *fakeRows) Next(dest []driver.Value) error {
+	if r.pos >= len(r.rows) {
+		return io.EOF
+	}
+	copy(dest, r.rows[r.pos])
+	r.pos++
+	return nil
+}
+
+func attributeMap(kvs []attribute.KeyValue) map[string]interface{} {
+	m := make(map[string]interface{}, len(kvs))
+	for _, kv := range kvs {
+		m[string(kv.Key)] = kv.Value.AsInterface()
+	}
+	return m
+}
+
+func TestOpen_QueryRecordsSpan(t *testing.T) {
+	exporter := tracetest.NewInMemoryExporter()
+	tp := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+	t.Cleanup(func() { _ = tp.Shutdown(context.Background()) })
+
+	db, err := otelsql.Open("fakedriver-query", fakeDriver{}, "",
+		otelsql.WithTracerProvider(tp), otelsql.WithDBSystem("fakedb"))
+	if err != nil {
+		t.Fatalf("Open: %v", err)
+	}
+	t.Cleanup(func() { _ = db.Close() })
+
+	rows, err := db.QueryContext(context.Background(), "SELECT id FROM t")
+	if err != nil {
+		t.Fatalf("QueryContext: %v", err)
+	}
+	count := 0
+	for rows.Next() {
+		count++
+	}
+	if err := rows.Err(); err != nil {
+		t.Fatalf("rows.Err: %v", err)
+	}
+	if err := rows.Close(); err != nil {
+		t.Fatalf("rows.Close: %v", err)
+	}
+	if count != 2 {
+		t.Fatalf("want 2 rows, got %d", count)
+	}
+
+	spans := exporter.GetSpans()
+	if len(spans) != 1 {
+		t.Fatalf("want 1 span, got %d", len(spans))
+	}
+	attrs := attributeMap(spans[0].Attributes)
+	if attrs["db.statement"] != "SELECT id FROM t" {
+		t.Errorf("db.statement = %v", attrs["db.statement"])
+	}
+	if attrs["db.rows_affected"] != int64(2) {
+		t.Errorf("db.rows_affected = %v", attrs["db.rows_affected"])
+	}
+}
+
+// database/sql.Register は同名で2回目に呼ぶとpanicするため、同じ基底ドライバ名で
+// Register/Openを複数回呼んでもクラッシュしないことを確認する
+func TestRegister_Idempotent(t *testing.T) {
+	name1 := otelsql.Register("fakedriver-idempotent", fakeDriver{})
+	name2 := otelsql.Register("fakedriver-idempotent", fakeDriver{})
+	if name1 != name2 {
+		t.Fatalf("wrapped names differ: %q vs %q", name1, name2)
+	}
+}
@@ -0,0 +1,113 @@
+package isuexporter
+
+import (
+	"context"
+	"sync"
+	"testing"
+
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/attribute"
+	sdktrace "go.opentelemetry.io/otel/sdk/trace"
+)
+
+// InMemorySpanExporter はエクスポートされたスパンをファイルやコレクタへ送らず
+// メモリ上に保持するだけの SpanExporter。ライブラリ利用者がコレクタを
+// 立てずに、計装したハンドラが出すスパンをユニットテストで検証するために使う。
+type InMemorySpanExporter struct {
+	mu    sync.Mutex
+	spans []sdktrace.ReadOnlySpan
+}
+
+// NewInMemorySpanExporter は空の InMemorySpanExporter を作成する
+func NewInMemorySpanExporter() *InMemorySpanExporter {
+	return &InMemorySpanExporter{}
+}
+
+// ExportSpans メソッドを実装（SpanExporter インターフェースを満たす）
+func (e *InMemorySpanExporter) ExportSpans(ctx context.Context, spans []sdktrace.ReadOnlySpan) error {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = append(e.spans, spans...)
+	return nil
+}
+
+func (e *InMemorySpanExporter) Shutdown(ctx context.Context) error {
+	return nil
+}
+
+// Spans はこれまでにエクスポートされたスパンのコピーを返す
+func (e *InMemorySpanExporter) Spans() []sdktrace.ReadOnlySpan {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	spans := make([]sdktrace.ReadOnlySpan, len(e.spans))
+	copy(spans, e.spans)
+	return spans
+}
+
+// Reset は記録済みのスパンをすべて破棄する
+func (e *InMemorySpanExporter) Reset() {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+	e.spans = nil
+}
+
+// SpanRecorder は TestProvider が返すハンドルで、記録されたスパンに対する
+// 簡易なアサーションヘルパーを提供する
+type SpanRecorder struct {
+	exporter *InMemorySpanExporter
+}
+
+// Spans はこれまでにエクスポートされたスパンのコピーを返す
+func (r *SpanRecorder) Spans() []sdktrace.ReadOnlySpan {
+	return r.exporter.Spans()
+}
+
+// Reset は記録済みのスパンをすべて破棄する
+func (r *SpanRecorder) Reset() {
+	r.exporter.Reset()
+}
+
+// FindByName は指定した名前を持つスパンをすべて返す
+func (r *SpanRecorder) FindByName(name string) []sdktrace.ReadOnlySpan {
+	var matched []sdktrace.ReadOnlySpan
+	for _, span := range r.Spans() {
+		if span.Name() == name {
+			matched = append(matched, span)
+		}
+	}
+	return matched
+}
+
+// FindByAttribute は key属性の値が val と一致するスパンをすべて返す
+func (r *SpanRecorder) FindByAttribute(key attribute.Key, val interface{}) []sdktrace.ReadOnlySpan {
+	var matched []sdktrace.ReadOnlySpan
+	for _, span := range r.Spans() {
+		for _, kv := range span.Attributes() {
+			if kv.Key == key && kv.Value.AsInterface() == val {
+				matched = append(matched, span)
+				break
+			}
+		}
+	}
+	return matched
+}
+
+// TestProvider は InMemorySpanExporter を WithSyncer で同期的に登録した
+// TracerProvider をグローバルに設定し、記録済みスパンを検査できる
+// SpanRecorder を返す。t.Cleanup で自動的に後始末される。
+func TestProvider(t *testing.T) *SpanRecorder {
+	t.Helper()
+
+	exporter := NewInMemorySpanExporter()
+	tracerProvider := sdktrace.NewTracerProvider(
+		sdktrace.WithSyncer(exporter),
+		sdktrace.WithSampler(sdktrace.AlwaysSample()),
+	)
+	otel.SetTracerProvider(tracerProvider)
+
+	t.Cleanup(func() {
+		_ = tracerProvider.Shutdown(context.Background())
+	})
+
+	return &SpanRecorder{exporter: exporter}
+}